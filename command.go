@@ -0,0 +1,242 @@
+package tsgo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Response is the parsed result of a ServerQuery command. A command reply is
+// made up of zero or more '|' separated records followed by a terminating
+// "error id=... msg=..." line, the fields of that terminating line are
+// exposed as ID and Msg
+type Response struct {
+	// Records holds one map per '|' separated record the server returned,
+	// values have already been unescaped
+	Records []map[string]string
+	// ID is the error id from the terminating line, 0 indicates success
+	ID int
+	// Msg is the error msg from the terminating line, "ok" on success
+	Msg string
+}
+
+// Ok reports whether the command the Response belongs to completed successfully
+func (r *Response) Ok() bool {
+	return r != nil && r.ID == 0
+}
+
+// pendingCommand represents a command that has been written to the server and
+// is waiting on its matching response. The TS3 ServerQuery protocol replies to
+// commands in the order they were received, so pending commands are matched
+// to replies in FIFO order by the listener routine
+type pendingCommand struct {
+	reply chan *Response
+}
+
+// buildCommand serializes a command name, its key/value arguments, and any
+// "-option" flags into a single ServerQuery command string, escaping argument
+// values as required by the protocol
+func buildCommand(cmd string, args map[string]string, options []string) string {
+	var b strings.Builder
+	b.WriteString(cmd)
+
+	for k, v := range args {
+		b.WriteString(" ")
+		b.WriteString(k)
+		b.WriteString("=")
+		b.WriteString(tsEscape(v))
+	}
+
+	for _, o := range options {
+		b.WriteString(" -")
+		b.WriteString(o)
+	}
+
+	return b.String()
+}
+
+// parseRecords splits a raw server line into its '|' separated records and
+// further splits each record into its key=value fields, unescaping values
+// along the way
+func parseRecords(line string) []map[string]string {
+	parts := strings.Split(line, "|")
+	records := make([]map[string]string, 0, len(parts))
+
+	for _, part := range parts {
+		fields := strings.Fields(part)
+		rec := make(map[string]string, len(fields))
+		for _, f := range fields {
+			kv := strings.SplitN(f, "=", 2)
+			if len(kv) == 2 {
+				rec[kv[0]] = tsUnescape(kv[1])
+			} else {
+				rec[kv[0]] = ""
+			}
+		}
+		records = append(records, rec)
+	}
+
+	return records
+}
+
+// SendCommand writes a raw ServerQuery command built from cmd, args, and options,
+// then blocks until the listener routine matches a reply to it. SendCommand is
+// safe to call concurrently from any goroutine, commands are queued and written
+// under a lock so that writes and their queue position stay in step with the
+// order the server will reply in, while the listener goroutine continues to
+// dispatch notifications to the Handler in between replies
+func (t *tsBot) SendCommand(cmd string, args map[string]string, options []string) (*Response, error) {
+	if conn, _ := t.conn(); conn == nil {
+		return nil, ErrNotConnected
+	}
+
+	full := buildCommand(cmd, args, options)
+	pc := &pendingCommand{reply: make(chan *Response, 1)}
+
+	t.cmdMu.Lock()
+	t.cmdQueue = append(t.cmdQueue, pc)
+	err := t.write(full)
+	if err != nil {
+		//the write never reached the server, so no reply will ever come for pc.
+		//cmdMu has been held since it was appended, so it is still the last
+		//entry in the queue, drop it rather than leaving it to absorb the
+		//reply meant for the next successful SendCommand call
+		t.cmdQueue = t.cmdQueue[:len(t.cmdQueue)-1]
+	}
+	t.cmdMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return <-pc.reply, nil
+}
+
+// completeCommand is called by the listener routine once it has read the
+// terminating "error id=... msg=..." line for the oldest pending command. It
+// parses that line, pairs the accumulated records with it, and delivers the
+// result to the waiting SendCommand caller
+func (t *tsBot) completeCommand(records []map[string]string, errLine string) {
+	resp := &Response{Records: records}
+
+	if r, err := t.parseResponse(errLine); err == nil && r != nil {
+		resp.Msg = r.Msg()
+		if id, err := strconv.Atoi(r.Data["id"]); err == nil {
+			resp.ID = id
+		}
+	}
+
+	t.cmdMu.Lock()
+	var pc *pendingCommand
+	if len(t.cmdQueue) > 0 {
+		pc = t.cmdQueue[0]
+		t.cmdQueue = t.cmdQueue[1:]
+	}
+	t.cmdMu.Unlock()
+
+	if pc != nil {
+		pc.reply <- resp
+	}
+}
+
+// ClientList returns one record per client currently connected to the selected server
+func (t *tsBot) ClientList() ([]map[string]string, error) {
+	res, err := t.SendCommand("clientlist", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !res.Ok() {
+		return nil, fmt.Errorf("clientlist failed: %s", res.Msg)
+	}
+	return res.Records, nil
+}
+
+// ChannelList returns one record per channel on the selected server
+func (t *tsBot) ChannelList() ([]map[string]string, error) {
+	res, err := t.SendCommand("channellist", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !res.Ok() {
+		return nil, fmt.Errorf("channellist failed: %s", res.Msg)
+	}
+	return res.Records, nil
+}
+
+// ClientMove moves the client identified by clientID into the channel identified by channelID
+func (t *tsBot) ClientMove(clientID, channelID int) error {
+	res, err := t.SendCommand("clientmove", map[string]string{
+		"clid": strconv.Itoa(clientID),
+		"cid":  strconv.Itoa(channelID),
+	}, nil)
+	if err != nil {
+		return err
+	}
+	if !res.Ok() {
+		return fmt.Errorf("clientmove failed: %s", res.Msg)
+	}
+	return nil
+}
+
+// ClientKick kicks the client identified by clientID from the server, reasonMsg is shown to the client
+func (t *tsBot) ClientKick(clientID int, reasonMsg string) error {
+	res, err := t.SendCommand("clientkick", map[string]string{
+		"clid":      strconv.Itoa(clientID),
+		"reasonid":  "5",
+		"reasonmsg": reasonMsg,
+	}, nil)
+	if err != nil {
+		return err
+	}
+	if !res.Ok() {
+		return fmt.Errorf("clientkick failed: %s", res.Msg)
+	}
+	return nil
+}
+
+// ClientPoke sends a poke notification containing msg to the client identified by clientID
+func (t *tsBot) ClientPoke(clientID int, msg string) error {
+	res, err := t.SendCommand("clientpoke", map[string]string{
+		"clid": strconv.Itoa(clientID),
+		"msg":  msg,
+	}, nil)
+	if err != nil {
+		return err
+	}
+	if !res.Ok() {
+		return fmt.Errorf("clientpoke failed: %s", res.Msg)
+	}
+	return nil
+}
+
+// ChannelCreate creates a new channel with the given name, returning its new channel ID
+func (t *tsBot) ChannelCreate(name string) (int, error) {
+	res, err := t.SendCommand("channelcreate", map[string]string{"channel_name": name}, nil)
+	if err != nil {
+		return 0, err
+	}
+	if !res.Ok() {
+		return 0, fmt.Errorf("channelcreate failed: %s", res.Msg)
+	}
+	if len(res.Records) == 0 {
+		return 0, nil
+	}
+	return strconv.Atoi(res.Records[0]["cid"])
+}
+
+// ServerNotifyRegister subscribes the bot to the given event type, optionally scoped
+// to id (e.g. a channel ID when event is "channel")
+func (t *tsBot) ServerNotifyRegister(event, id string) error {
+	args := map[string]string{"event": event}
+	if id != "" {
+		args["id"] = id
+	}
+
+	res, err := t.SendCommand("servernotifyregister", args, nil)
+	if err != nil {
+		return err
+	}
+	if !res.Ok() {
+		return fmt.Errorf("servernotifyregister failed: %s", res.Msg)
+	}
+	return nil
+}
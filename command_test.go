@@ -0,0 +1,81 @@
+package tsgo
+
+import (
+	"bufio"
+	"io"
+	"testing"
+	"time"
+)
+
+// fakeConn is a minimal io.ReadWriteCloser used to drive SendCommand/write
+// without a real server connection. Write fails once when failNext is set.
+type fakeConn struct {
+	failNext bool
+}
+
+func (f *fakeConn) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (f *fakeConn) Write(p []byte) (int, error) {
+	if f.failNext {
+		f.failNext = false
+		return 0, io.ErrClosedPipe
+	}
+	return len(p), nil
+}
+
+func (f *fakeConn) Close() error {
+	return nil
+}
+
+// TestSendCommandWriteFailureDoesNotOrphanQueue confirms that a SendCommand
+// call whose write fails removes its pendingCommand from cmdQueue, so the
+// next successful call's reply isn't matched to it instead
+func TestSendCommandWriteFailureDoesNotOrphanQueue(t *testing.T) {
+	fc := &fakeConn{failNext: true}
+	bot := &tsBot{server: fc, reader: bufio.NewScanner(fc), logger: noopLogger{}}
+
+	if _, err := bot.SendCommand("first", nil, nil); err == nil {
+		t.Fatal("expected the first SendCommand's write to fail")
+	}
+
+	bot.cmdMu.Lock()
+	n := len(bot.cmdQueue)
+	bot.cmdMu.Unlock()
+	if n != 0 {
+		t.Fatalf("cmdQueue has %d entries after a failed write, want 0", n)
+	}
+
+	done := make(chan *Response, 1)
+	errCh := make(chan error, 1)
+	go func() {
+		res, err := bot.SendCommand("second", nil, nil)
+		errCh <- err
+		done <- res
+	}()
+
+	for {
+		bot.cmdMu.Lock()
+		n := len(bot.cmdQueue)
+		bot.cmdMu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	bot.completeCommand(nil, "error id=0 msg=ok")
+
+	select {
+	case res := <-done:
+		if err := <-errCh; err != nil {
+			t.Fatalf("second SendCommand returned an error: %v", err)
+		}
+		if !res.Ok() {
+			t.Fatalf("expected an ok response, got %+v", res)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("second SendCommand never received its reply")
+	}
+}
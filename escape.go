@@ -0,0 +1,30 @@
+package tsgo
+
+import "strings"
+
+// tsEscape converts characters that carry special meaning in the TS3 ServerQuery
+// protocol (backslash, the path separator, the space character, and the record
+// separator) into their escaped form. Other whitespace is left as it is. This must be applied to any value sent to the server
+// as part of a command argument
+func tsEscape(s string) string {
+	r := strings.NewReplacer(
+		"\\", "\\\\",
+		"/", "\\/",
+		" ", "\\s",
+		"|", "\\p",
+	)
+	return r.Replace(s)
+}
+
+// tsUnescape reverses tsEscape, turning the escape sequences used by the server
+// back into their literal characters. This must be applied to any value read
+// back from the server before it is handed to calling code
+func tsUnescape(s string) string {
+	r := strings.NewReplacer(
+		"\\\\", "\\",
+		"\\/", "/",
+		"\\s", " ",
+		"\\p", "|",
+	)
+	return r.Replace(s)
+}
@@ -0,0 +1,278 @@
+package tsgo
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// EventType identifies a class of ServerQuery notification that the bot can
+// subscribe to via Subscribe
+type EventType string
+
+const (
+	// EventServer delivers client enter/leave/move notifications for the whole server
+	EventServer EventType = "server"
+	// EventChannel delivers client enter/leave/move notifications for a single channel,
+	// Subscribe must be called with the channel's ID
+	EventChannel EventType = "channel"
+	// EventTextServer delivers messages sent to the server
+	EventTextServer EventType = "textserver"
+	// EventTextChannel delivers messages sent to the currently joined channel
+	EventTextChannel EventType = "textchannel"
+	// EventTextPrivate delivers private messages sent directly to the bot
+	EventTextPrivate EventType = "textprivate"
+	// EventTokenUsed delivers notifications when a privilege key is used
+	EventTokenUsed EventType = "tokenused"
+)
+
+const (
+	actionClientEnter    = "notifycliententerview"
+	actionClientLeft     = "notifyclientleftview"
+	actionClientMoved    = "notifyclientmoved"
+	actionChannelCreated = "notifychannelcreated"
+)
+
+// ClientEnterEvent is delivered when a client joins a channel the bot is subscribed to
+type ClientEnterEvent struct {
+	ClientID   int
+	ClientName string
+	ClientUID  string
+	ChannelID  int
+}
+
+// ClientLeftEvent is delivered when a client leaves a channel the bot is subscribed to
+type ClientLeftEvent struct {
+	ClientID  int
+	ChannelID int
+	ReasonID  int
+	ReasonMsg string
+}
+
+// ClientMovedEvent is delivered when a client is moved into a different channel
+type ClientMovedEvent struct {
+	ClientID  int
+	ChannelID int
+	InvokerID int
+}
+
+// ChannelCreatedEvent is delivered when a new channel is created on the server
+type ChannelCreatedEvent struct {
+	ChannelID   int
+	ChannelName string
+	InvokerID   int
+}
+
+// PrivateMessageEvent is delivered when a client sends the bot a private message
+type PrivateMessageEvent struct {
+	Msg         string
+	InvokerID   int
+	InvokerName string
+	InvokerUID  string
+}
+
+// ServerMessageEvent is delivered when a client sends a message to the whole server
+type ServerMessageEvent struct {
+	Msg         string
+	InvokerID   int
+	InvokerName string
+	InvokerUID  string
+}
+
+// ClientEnterHandler handles ClientEnterEvent notifications
+type ClientEnterHandler func(e ClientEnterEvent)
+
+// ClientLeftHandler handles ClientLeftEvent notifications
+type ClientLeftHandler func(e ClientLeftEvent)
+
+// ClientMovedHandler handles ClientMovedEvent notifications
+type ClientMovedHandler func(e ClientMovedEvent)
+
+// ChannelCreatedHandler handles ChannelCreatedEvent notifications
+type ChannelCreatedHandler func(e ChannelCreatedEvent)
+
+// PrivateMessageHandler handles PrivateMessageEvent notifications, a returned
+// string is written back to the server as a private reply, same as Handler
+type PrivateMessageHandler func(e PrivateMessageEvent) (string, error)
+
+// ServerMessageHandler handles ServerMessageEvent notifications, a returned
+// string is written back to the server as a server message, same as Handler
+type ServerMessageHandler func(e ServerMessageEvent) (string, error)
+
+// OnClientEnter registers the handler invoked when a client enters a subscribed channel
+func (t *tsBot) OnClientEnter(h ClientEnterHandler) {
+	t.onClientEnter = h
+}
+
+// OnClientLeft registers the handler invoked when a client leaves a subscribed channel
+func (t *tsBot) OnClientLeft(h ClientLeftHandler) {
+	t.onClientLeft = h
+}
+
+// OnClientMoved registers the handler invoked when a client is moved to a different channel
+func (t *tsBot) OnClientMoved(h ClientMovedHandler) {
+	t.onClientMoved = h
+}
+
+// OnChannelCreated registers the handler invoked when a new channel is created
+func (t *tsBot) OnChannelCreated(h ChannelCreatedHandler) {
+	t.onChannelCreated = h
+}
+
+// OnPrivateMessage registers the handler invoked when the bot receives a private message
+func (t *tsBot) OnPrivateMessage(h PrivateMessageHandler) {
+	t.onPrivateMessage = h
+}
+
+// OnServerMessage registers the handler invoked when a message is sent to the whole server
+func (t *tsBot) OnServerMessage(h ServerMessageHandler) {
+	t.onServerMessage = h
+}
+
+// Subscribe issues the servernotifyregister command needed to receive the given
+// event type. EventChannel requires id to be the channel to subscribe to, for
+// every other event type id is ignored and may be left as 0. The subscription
+// is recorded so it can be replayed automatically after a reconnect
+func (t *tsBot) Subscribe(event EventType, id int) error {
+	idStr := ""
+	if event == EventChannel {
+		idStr = strconv.Itoa(id)
+	}
+
+	if err := t.ServerNotifyRegister(string(event), idStr); err != nil {
+		return err
+	}
+
+	t.subsMu.Lock()
+	t.subscriptions = append(t.subscriptions, subscription{event: event, id: id})
+	t.subsMu.Unlock()
+
+	return nil
+}
+
+// dispatchEvent parses a notify* line into its typed event and forwards it to
+// whichever handler has been registered for it, returning without effect when
+// no handler is registered for that notification
+func (t *tsBot) dispatchEvent(r *response) {
+	switch r.Action {
+	case actionClientEnter:
+		if t.onClientEnter == nil {
+			return
+		}
+		clid, _ := strconv.Atoi(r.Data["clid"])
+		ctid, _ := strconv.Atoi(r.Data["ctid"])
+		t.onClientEnter(ClientEnterEvent{
+			ClientID:   clid,
+			ClientName: r.Data["client_nickname"],
+			ClientUID:  r.Data["client_unique_identifier"],
+			ChannelID:  ctid,
+		})
+	case actionClientLeft:
+		if t.onClientLeft == nil {
+			return
+		}
+		clid, _ := strconv.Atoi(r.Data["clid"])
+		cfid, _ := strconv.Atoi(r.Data["cfid"])
+		reasonID, _ := strconv.Atoi(r.Data["reasonid"])
+		t.onClientLeft(ClientLeftEvent{
+			ClientID:  clid,
+			ChannelID: cfid,
+			ReasonID:  reasonID,
+			ReasonMsg: r.Data["reasonmsg"],
+		})
+	case actionClientMoved:
+		if t.onClientMoved == nil {
+			return
+		}
+		clid, _ := strconv.Atoi(r.Data["clid"])
+		ctid, _ := strconv.Atoi(r.Data["ctid"])
+		invokerID, _ := strconv.Atoi(r.Data["invokerid"])
+		t.onClientMoved(ClientMovedEvent{
+			ClientID:  clid,
+			ChannelID: ctid,
+			InvokerID: invokerID,
+		})
+	case actionChannelCreated:
+		if t.onChannelCreated == nil {
+			return
+		}
+		cid, _ := strconv.Atoi(r.Data["cid"])
+		invokerID, _ := strconv.Atoi(r.Data["invokerid"])
+		t.onChannelCreated(ChannelCreatedEvent{
+			ChannelID:   cid,
+			ChannelName: r.Data["channel_name"],
+			InvokerID:   invokerID,
+		})
+	case MSG_ACTION:
+		t.dispatchTextMessage(r)
+	}
+}
+
+// dispatchTextMessage routes a notifytextmessage line to the legacy channel Handler,
+// OnPrivateMessage, or OnServerMessage based on its targetmode field
+func (t *tsBot) dispatchTextMessage(r *response) {
+	//prevent the bot from responding to itself
+	if r.Data["invokeruid"] == t.cfg.Username {
+		return
+	}
+
+	invId, err := strconv.Atoi(r.Data["invokerid"])
+	if err != nil {
+		t.reportError("failed to parse invokerid", err, "raw", r.Data["invokerid"])
+		return
+	}
+
+	switch r.Data["targetmode"] {
+	case "1":
+		if t.onPrivateMessage == nil {
+			return
+		}
+		reply, err := t.onPrivateMessage(PrivateMessageEvent{
+			Msg:         r.Msg(),
+			InvokerID:   invId,
+			InvokerName: r.Data["invokername"],
+			InvokerUID:  r.Data["invokeruid"],
+		})
+		t.replyTo(1, invId, reply, err)
+	case "3":
+		if t.onServerMessage == nil {
+			return
+		}
+		reply, err := t.onServerMessage(ServerMessageEvent{
+			Msg:         r.Msg(),
+			InvokerID:   invId,
+			InvokerName: r.Data["invokername"],
+			InvokerUID:  r.Data["invokeruid"],
+		})
+		t.replyTo(3, invId, reply, err)
+	default:
+		if t.handler == nil {
+			return
+		}
+		reply, err := t.handler(Message{
+			Msg:         r.Msg(),
+			InvokerID:   invId,
+			InvokerName: r.Data["invokername"],
+			InvokerUID:  r.Data["invokeruid"],
+		})
+		//targetmode=2 with the invoker's client ID mirrors the original behaviour
+		//of replying in the channel the message was sent from
+		t.replyTo(2, invId, reply, err)
+	}
+}
+
+// replyTo writes a handler's reply back to the server using the given
+// sendtextmessage targetmode and target
+func (t *tsBot) replyTo(targetmode, target int, reply string, err error) {
+	if err != nil {
+		t.reportError("handler returned an error", err, "invoker", target)
+		return
+	}
+
+	if reply == "" {
+		return
+	}
+
+	if err := t.write(fmt.Sprintf("sendtextmessage targetmode=%d target=%d msg=%s", targetmode, target, tsEscape(reply))); err != nil {
+		t.reportError("failed to write reply", err, "invoker", target)
+	}
+}
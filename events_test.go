@@ -0,0 +1,117 @@
+package tsgo
+
+import (
+	"bufio"
+	"testing"
+	"time"
+)
+
+func TestDispatchEventClientEnter(t *testing.T) {
+	var got ClientEnterEvent
+	bot := &tsBot{logger: noopLogger{}}
+	bot.OnClientEnter(func(e ClientEnterEvent) { got = e })
+
+	bot.dispatchEvent(&response{
+		Action: actionClientEnter,
+		Data: map[string]string{
+			"clid":                     "12",
+			"ctid":                     "3",
+			"client_nickname":          "nora",
+			"client_unique_identifier": "uid==",
+		},
+	})
+
+	want := ClientEnterEvent{ClientID: 12, ClientName: "nora", ClientUID: "uid==", ChannelID: 3}
+	if got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestDispatchEventNoHandlerRegistered(t *testing.T) {
+	bot := &tsBot{logger: noopLogger{}}
+	//must not panic when no On* handler has been registered for the action
+	bot.dispatchEvent(&response{Action: actionClientEnter, Data: map[string]string{}})
+	bot.dispatchEvent(&response{Action: actionChannelCreated, Data: map[string]string{}})
+}
+
+func TestDispatchTextMessageIgnoresSelf(t *testing.T) {
+	called := false
+	bot := &tsBot{
+		logger: noopLogger{},
+		cfg:    Config{Username: "bot-user"},
+	}
+	bot.OnServerMessage(func(e ServerMessageEvent) (string, error) {
+		called = true
+		return "", nil
+	})
+
+	bot.dispatchTextMessage(&response{
+		Action: MSG_ACTION,
+		Data: map[string]string{
+			"targetmode": "3",
+			"invokerid":  "5",
+			"invokeruid": "bot-user",
+			"msg":        "hello",
+		},
+	})
+
+	if called {
+		t.Fatal("expected a message from the bot's own UID to be ignored")
+	}
+}
+
+func TestDispatchTextMessageRoutesByTargetmode(t *testing.T) {
+	var got PrivateMessageEvent
+	bot := &tsBot{logger: noopLogger{}}
+	bot.OnPrivateMessage(func(e PrivateMessageEvent) (string, error) {
+		got = e
+		return "", nil
+	})
+
+	bot.dispatchTextMessage(&response{
+		Action: MSG_ACTION,
+		Data: map[string]string{
+			"targetmode":  "1",
+			"invokerid":   "9",
+			"invokername": "nora",
+			"invokeruid":  "uid==",
+			"msg":         "hi\\sthere",
+		},
+	})
+
+	want := PrivateMessageEvent{Msg: "hi there", InvokerID: 9, InvokerName: "nora", InvokerUID: "uid=="}
+	if got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestSubscribeRecordsSubscription(t *testing.T) {
+	fc := &fakeConn{}
+	bot := &tsBot{server: fc, reader: bufio.NewScanner(fc), logger: noopLogger{}}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- bot.Subscribe(EventChannel, 7)
+	}()
+
+	for {
+		bot.cmdMu.Lock()
+		n := len(bot.cmdQueue)
+		bot.cmdMu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	bot.completeCommand(nil, "error id=0 msg=ok")
+
+	if err := <-done; err != nil {
+		t.Fatalf("Subscribe returned an error: %v", err)
+	}
+
+	bot.subsMu.Lock()
+	defer bot.subsMu.Unlock()
+	if len(bot.subscriptions) != 1 || bot.subscriptions[0] != (subscription{event: EventChannel, id: 7}) {
+		t.Fatalf("unexpected subscriptions: %+v", bot.subscriptions)
+	}
+}
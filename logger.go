@@ -0,0 +1,59 @@
+package tsgo
+
+import "log/slog"
+
+// Logger is implemented by anything that can record structured log lines for
+// the bot. Each method takes a message followed by an even number of
+// alternating key/value arguments, mirroring the convention used by log/slog
+type Logger interface {
+	Debug(msg string, kv ...interface{})
+	Info(msg string, kv ...interface{})
+	Warn(msg string, kv ...interface{})
+	Error(msg string, kv ...interface{})
+}
+
+// noopLogger discards every log line, it is the Logger used when Config.Logger is left unset
+type noopLogger struct{}
+
+func (noopLogger) Debug(msg string, kv ...interface{}) {}
+func (noopLogger) Info(msg string, kv ...interface{})  {}
+func (noopLogger) Warn(msg string, kv ...interface{})  {}
+func (noopLogger) Error(msg string, kv ...interface{}) {}
+
+// slogLogger adapts a *slog.Logger to the Logger interface
+type slogLogger struct {
+	l *slog.Logger
+}
+
+// NewSlogLogger wraps l so it can be used as a tsgo Logger, this is a convenience
+// for callers who already use log/slog elsewhere and want tsgo to log the same way
+func NewSlogLogger(l *slog.Logger) Logger {
+	return &slogLogger{l: l}
+}
+
+func (s *slogLogger) Debug(msg string, kv ...interface{}) { s.l.Debug(msg, kv...) }
+func (s *slogLogger) Info(msg string, kv ...interface{})  { s.l.Info(msg, kv...) }
+func (s *slogLogger) Warn(msg string, kv ...interface{})  { s.l.Warn(msg, kv...) }
+func (s *slogLogger) Error(msg string, kv ...interface{}) { s.l.Error(msg, kv...) }
+
+// reportError logs err through the configured Logger with msg and any extra
+// key/value context, and forwards it on the errors channel. The send never
+// blocks the listener routine, if nothing is reading ErrorsChan the error is dropped
+func (t *tsBot) reportError(msg string, err error, kv ...interface{}) {
+	args := append([]interface{}{"error", err}, kv...)
+	t.logger.Error(msg, args...)
+
+	select {
+	case t.errCh <- err:
+	default:
+	}
+}
+
+// ErrorsChan returns a channel that receives every error encountered by the
+// listener routine, so callers can react to listener failures programmatically
+// instead of only observing them through the configured Logger. The channel is
+// buffered and never closed, errors are dropped rather than blocking the
+// listener if nothing is receiving
+func (t *tsBot) ErrorsChan() <-chan error {
+	return t.errCh
+}
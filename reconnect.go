@@ -0,0 +1,196 @@
+package tsgo
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// ReconnectPolicy configures automatic reconnection when the underlying
+// connection to the server is lost. If Config.Reconnect is left nil, a lost
+// connection is fatal and the listener routine exits, same as before
+type ReconnectPolicy struct {
+	//MaxRetries is the number of reconnect attempts to make before giving up,
+	//0 means retry forever
+	MaxRetries int
+	//InitialBackoff is the delay after the first failed reconnect attempt (the
+	//first attempt is made immediately), doubling after each further failed
+	//attempt. 0 or less uses one second
+	InitialBackoff time.Duration
+	//MaxBackoff caps the delay between reconnect attempts, 0 means uncapped
+	MaxBackoff time.Duration
+	//Jitter adds a random amount, up to the current backoff, to each delay to
+	//avoid many bots reconnecting in lockstep
+	Jitter bool
+}
+
+// subscription records a previously registered event subscription so it can be
+// replayed against the server after a reconnect
+type subscription struct {
+	event EventType
+	id    int
+}
+
+// connect dials the server through the configured Transport, consumes its welcome
+// banner (if the transport sends one), and logs in. It is used both for the initial
+// connection in Start and for every reconnect attempt
+func (t *tsBot) connect() error {
+	conn, err := t.transport.Dial()
+	if err != nil {
+		return err
+	}
+
+	t.setConn(conn, bufio.NewScanner(conn))
+
+	if t.transport.SendsBanner() {
+		for x := 0; x < BANNER_LENGTH; x++ {
+			if _, err := t.read(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return t.login()
+}
+
+// replaySubscriptions re-issues servernotifyregister for every subscription
+// recorded so far, used to restore event delivery after a reconnect
+func (t *tsBot) replaySubscriptions() error {
+	t.subsMu.Lock()
+	subs := append([]subscription(nil), t.subscriptions...)
+	t.subsMu.Unlock()
+
+	for _, s := range subs {
+		args := map[string]string{"event": string(s.event)}
+		if s.event == EventChannel {
+			args["id"] = strconv.Itoa(s.id)
+		}
+
+		if err := t.writeSuccess(buildCommand("servernotifyregister", args, nil)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// failPendingCommands completes every SendCommand call currently waiting on a
+// reply with a failed Response (ID -1, Msg set to err's text), since a lost
+// connection means the server will never answer them. Those SendCommand calls
+// return that Response with a nil error
+func (t *tsBot) failPendingCommands(err error) {
+	t.cmdMu.Lock()
+	pending := t.cmdQueue
+	t.cmdQueue = nil
+	t.cmdMu.Unlock()
+
+	for _, pc := range pending {
+		pc.reply <- &Response{ID: -1, Msg: err.Error()}
+	}
+}
+
+// reconnectLoop attempts to re-establish the connection according to
+// Config.Reconnect, re-dialing, re-logging in, re-selecting the server, and
+// replaying every previously registered subscription. It reports whether the
+// caller should resume listening (true) or give up (false)
+func (t *tsBot) reconnectLoop() bool {
+	t.failPendingCommands(ErrNotConnected)
+
+	if t.reconnect == nil {
+		return false
+	}
+
+	backoff := t.reconnect.InitialBackoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+
+	for attempt := 1; t.reconnect.MaxRetries == 0 || attempt <= t.reconnect.MaxRetries; attempt++ {
+		if t.ctx.Err() != nil {
+			return false
+		}
+
+		t.logger.Warn("attempting reconnect", "attempt", attempt)
+
+		if err := t.reconnectOnce(); err != nil {
+			t.reportError("reconnect attempt failed", err, "attempt", attempt)
+		} else {
+			t.logger.Info("reconnected", "attempt", attempt)
+			return true
+		}
+
+		wait := backoff
+		if t.reconnect.Jitter {
+			wait += time.Duration(rand.Int63n(int64(backoff) + 1))
+		}
+		if t.reconnect.MaxBackoff > 0 && wait > t.reconnect.MaxBackoff {
+			wait = t.reconnect.MaxBackoff
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-t.ctx.Done():
+			timer.Stop()
+			return false
+		}
+
+		backoff *= 2
+		if t.reconnect.MaxBackoff > 0 && backoff > t.reconnect.MaxBackoff {
+			backoff = t.reconnect.MaxBackoff
+		}
+	}
+
+	return false
+}
+
+// reconnectOnce performs a single reconnect attempt: dial, login, select the
+// server, and replay subscriptions. It holds handshakeMu for its entire
+// duration so keepaliveLoop can't slip a command onto the newly dialed
+// connection before the handshake has read all of its own replies
+func (t *tsBot) reconnectOnce() error {
+	t.handshakeMu.Lock()
+	defer t.handshakeMu.Unlock()
+
+	if err := t.connect(); err != nil {
+		return err
+	}
+
+	if err := t.writeSuccess(fmt.Sprintf(SERVER_USE_STRING, t.cfg.Server)); err != nil {
+		return err
+	}
+
+	return t.replaySubscriptions()
+}
+
+// keepaliveLoop periodically issues a cheap ServerQuery command so the
+// connection doesn't sit idle long enough for the server to drop it. It exits
+// once the bot's context is done
+func (t *tsBot) keepaliveLoop() {
+	defer t.wg.Done()
+
+	if t.cfg.KeepaliveInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(t.cfg.KeepaliveInterval)
+	defer ticker.Stop()
+
+	for t.ctx.Err() == nil {
+		select {
+		case <-ticker.C:
+			//blocks until reconnectOnce releases handshakeMu, so a keepalive
+			//can never land on the wire mid-handshake
+			t.handshakeMu.RLock()
+			_, err := t.SendCommand("whoami", nil, nil)
+			t.handshakeMu.RUnlock()
+			if err != nil {
+				t.reportError("keepalive failed", err)
+			}
+		case <-t.ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package tsgo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// alwaysFailTransport fails every Dial, forcing reconnectLoop into its backoff sleep
+type alwaysFailTransport struct{}
+
+func (alwaysFailTransport) Dial() (io.ReadWriteCloser, error) {
+	return nil, errors.New("dial failed")
+}
+
+func (alwaysFailTransport) SendsBanner() bool {
+	return false
+}
+
+// TestReconnectLoopStopsOnContextCancel confirms that cancelling the bot's
+// context interrupts the backoff sleep instead of waiting it out
+func TestReconnectLoopStopsOnContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	bot := &tsBot{
+		ctx:       ctx,
+		logger:    noopLogger{},
+		transport: alwaysFailTransport{},
+		reconnect: &ReconnectPolicy{
+			InitialBackoff: time.Hour,
+		},
+	}
+
+	done := make(chan bool, 1)
+	go func() {
+		done <- bot.reconnectLoop()
+	}()
+
+	//give reconnectOnce a chance to fail and enter the backoff sleep
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case ok := <-done:
+		if ok {
+			t.Fatal("expected reconnectLoop to report failure after the context was cancelled")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reconnectLoop did not return promptly after context cancellation")
+	}
+}
@@ -0,0 +1,198 @@
+package tsgo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Middleware wraps a Handler to add cross-cutting behaviour (logging, panic
+// recovery, rate limiting, ACLs, ...) without the wrapped Handler needing to
+// know about it
+type Middleware func(Handler) Handler
+
+// Router dispatches a Message to the Handler registered for the first
+// whitespace-separated token of its Msg field, passing the remainder of the
+// message through as Msg to that Handler. A Router can be passed to AddHandler
+// in place of a plain Handler
+type Router struct {
+	mu     sync.RWMutex
+	routes map[string]Handler
+	mw     []Middleware
+}
+
+// NewRouter creates an empty Router ready to have routes registered on it
+func NewRouter() *Router {
+	return &Router{routes: make(map[string]Handler)}
+}
+
+// Use appends mw to the chain applied to every route registered on the Router.
+// Middleware runs in the order it was added, with the first call to Use
+// being the outermost wrapper and the last call wrapping closest to the
+// matched Handler
+func (r *Router) Use(mw Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mw = append(r.mw, mw)
+}
+
+// Handle registers h to handle messages whose first whitespace-separated token
+// matches prefix
+func (r *Router) Handle(prefix string, h Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.routes[prefix] = h
+}
+
+// HandleFunc is a convenience alias for Handle, useful when registering a
+// function literal directly
+func (r *Router) HandleFunc(prefix string, h Handler) {
+	r.Handle(prefix, h)
+}
+
+// route looks up the Handler registered for prefix and wraps it with the
+// Router's middleware chain, returning nil if no route matches
+func (r *Router) route(prefix string) Handler {
+	r.mu.RLock()
+	h, ok := r.routes[prefix]
+	mw := append([]Middleware(nil), r.mw...)
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil
+	}
+
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+
+	return h
+}
+
+// Dispatch implements Handler: it splits m.Msg on its first whitespace, routes
+// on that token, and forwards the remainder of the message as Msg to the
+// matched Handler. If no route matches, Dispatch returns "", nil
+func (r *Router) Dispatch(m Message) (string, error) {
+	prefix, rest := splitCommand(m.Msg)
+
+	h := r.route(prefix)
+	if h == nil {
+		return "", nil
+	}
+
+	m.Msg = rest
+	return h(m)
+}
+
+// splitCommand separates the first whitespace-separated token of msg (the
+// command) from the remainder of the message (its arguments)
+func splitCommand(msg string) (string, string) {
+	parts := strings.SplitN(strings.TrimSpace(msg), " ", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], strings.TrimSpace(parts[1])
+}
+
+// LoggingMiddleware logs every invocation of the wrapped Handler, and its
+// result, through logger
+func LoggingMiddleware(logger Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(m Message) (string, error) {
+			logger.Info("handling command", "invoker", m.InvokerUID, "msg", m.Msg)
+
+			reply, err := next(m)
+			if err != nil {
+				logger.Error("command failed", "invoker", m.InvokerUID, "error", err)
+			}
+
+			return reply, err
+		}
+	}
+}
+
+// RecoverMiddleware converts a panic inside the wrapped Handler into an error,
+// preventing it from crashing the listener routine
+func RecoverMiddleware() Middleware {
+	return func(next Handler) Handler {
+		return func(m Message) (reply string, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("tsgo: handler panicked: %v", r)
+				}
+			}()
+
+			return next(m)
+		}
+	}
+}
+
+// RateLimitMiddleware allows each InvokerUID to trigger the wrapped Handler at
+// most once per interval, silently dropping calls that arrive sooner
+func RateLimitMiddleware(interval time.Duration) Middleware {
+	var mu sync.Mutex
+	last := make(map[string]time.Time)
+
+	return func(next Handler) Handler {
+		return func(m Message) (string, error) {
+			mu.Lock()
+			now := time.Now()
+			prev, ok := last[m.InvokerUID]
+			if ok && now.Sub(prev) < interval {
+				mu.Unlock()
+				return "", nil
+			}
+			last[m.InvokerUID] = now
+			mu.Unlock()
+
+			return next(m)
+		}
+	}
+}
+
+// ACLMiddleware only allows invokers whose UID is in allowedUIDs to run the
+// wrapped Handler, every other invoker is silently ignored
+func ACLMiddleware(allowedUIDs ...string) Middleware {
+	allowed := make(map[string]struct{}, len(allowedUIDs))
+	for _, uid := range allowedUIDs {
+		allowed[uid] = struct{}{}
+	}
+
+	return func(next Handler) Handler {
+		return func(m Message) (string, error) {
+			if _, ok := allowed[m.InvokerUID]; !ok {
+				return "", nil
+			}
+			return next(m)
+		}
+	}
+}
+
+// ACLGroupMiddleware only allows invokers belonging to one of allowedGroups
+// (server group IDs) to run the wrapped Handler, looking the invoker's groups
+// up via clientinfo on every call. Every other invoker is silently ignored
+func ACLGroupMiddleware(bot TsBot, allowedGroups ...string) Middleware {
+	allowed := make(map[string]struct{}, len(allowedGroups))
+	for _, g := range allowedGroups {
+		allowed[g] = struct{}{}
+	}
+
+	return func(next Handler) Handler {
+		return func(m Message) (string, error) {
+			res, err := bot.SendCommand("clientinfo", map[string]string{"clid": strconv.Itoa(m.InvokerID)}, nil)
+			if err != nil || !res.Ok() || len(res.Records) == 0 {
+				return "", nil
+			}
+
+			for _, g := range strings.Split(res.Records[0]["client_servergroups"], ",") {
+				if _, ok := allowed[g]; ok {
+					return next(m)
+				}
+			}
+
+			return "", nil
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package tsgo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSplitCommand(t *testing.T) {
+	cases := []struct {
+		in, wantCmd, wantRest string
+	}{
+		{"!ping", "!ping", ""},
+		{"!echo hello world", "!echo", "hello world"},
+		{"  !ping  ", "!ping", ""},
+		{"", "", ""},
+	}
+
+	for _, c := range cases {
+		cmd, rest := splitCommand(c.in)
+		if cmd != c.wantCmd || rest != c.wantRest {
+			t.Errorf("splitCommand(%q) = (%q, %q), want (%q, %q)", c.in, cmd, rest, c.wantCmd, c.wantRest)
+		}
+	}
+}
+
+func TestRouterDispatch(t *testing.T) {
+	r := NewRouter()
+	r.Handle("!echo", func(m Message) (string, error) {
+		return m.Msg, nil
+	})
+
+	reply, err := r.Dispatch(Message{Msg: "!echo hello world"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != "hello world" {
+		t.Fatalf("got %q, want %q", reply, "hello world")
+	}
+
+	reply, err = r.Dispatch(Message{Msg: "!unknown"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != "" {
+		t.Fatalf("expected no reply for an unregistered command, got %q", reply)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	calls := 0
+	next := Handler(func(m Message) (string, error) {
+		calls++
+		return "", nil
+	})
+	wrapped := RateLimitMiddleware(time.Minute)(next)
+
+	if _, err := wrapped(Message{InvokerUID: "u1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wrapped(Message{InvokerUID: "u1"}); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected the second call within the interval to be dropped, got %d calls", calls)
+	}
+
+	if _, err := wrapped(Message{InvokerUID: "u2"}); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected a different invoker to not be rate limited, got %d calls", calls)
+	}
+}
+
+func TestACLMiddleware(t *testing.T) {
+	called := false
+	next := Handler(func(m Message) (string, error) {
+		called = true
+		return "", nil
+	})
+	wrapped := ACLMiddleware("allowed-uid")(next)
+
+	if _, err := wrapped(Message{InvokerUID: "someone-else"}); err != nil {
+		t.Fatal(err)
+	}
+	if called {
+		t.Fatal("expected a UID not in the allow list to be blocked")
+	}
+
+	if _, err := wrapped(Message{InvokerUID: "allowed-uid"}); err != nil {
+		t.Fatal(err)
+	}
+	if !called {
+		t.Fatal("expected an allowed UID to reach the handler")
+	}
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	next := Handler(func(m Message) (string, error) {
+		panic("boom")
+	})
+	wrapped := RecoverMiddleware()(next)
+
+	if _, err := wrapped(Message{}); err == nil {
+		t.Fatal("expected a recovered panic to surface as an error")
+	}
+}
@@ -0,0 +1,156 @@
+package tsgo
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Transport establishes the underlying connection used to reach a TS3
+// ServerQuery endpoint. PlainTransport, TLSTransport, and SSHTransport are
+// provided, Config.Transport defaults to a PlainTransport when left nil
+type Transport interface {
+	// Dial opens a new connection to the server
+	Dial() (io.ReadWriteCloser, error)
+	// SendsBanner reports whether the server sends the two-line welcome banner
+	// immediately after connecting. Plain and TLS connections do, SSH does not
+	SendsBanner() bool
+}
+
+// deadlineSetter is implemented by connections that support read deadlines.
+// PlainTransport and TLSTransport connections do, the SSH transport does not,
+// so the listener routine falls back to blocking reads for it
+type deadlineSetter interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// PlainTransport dials a plain, unencrypted TCP connection. This is the
+// transport used when Config.Transport is left nil, preserving the original
+// net.Dial("tcp", ...) behavior
+type PlainTransport struct {
+	Address string
+	Port    string
+}
+
+// Dial opens a plain TCP connection to Address:Port
+func (p *PlainTransport) Dial() (io.ReadWriteCloser, error) {
+	return net.Dial(PROTOCOL, net.JoinHostPort(p.Address, p.Port))
+}
+
+// SendsBanner always returns true, plain ServerQuery sends the welcome banner
+func (p *PlainTransport) SendsBanner() bool {
+	return true
+}
+
+// TLSTransport dials the ServerQuery endpoint over TLS, as exposed on port
+// 10022 by modern TeamSpeak servers
+type TLSTransport struct {
+	Address string
+	Port    string
+	//TLSConfig is used as-is for the handshake, set ServerName for SNI, or
+	//RootCAs/VerifyPeerCertificate/InsecureSkipVerify to pin a certificate.
+	//If left nil, a config with ServerName set to Address is used
+	TLSConfig *tls.Config
+}
+
+// Dial opens a TLS connection to Address:Port
+func (t *TLSTransport) Dial() (io.ReadWriteCloser, error) {
+	cfg := t.TLSConfig
+	if cfg == nil {
+		cfg = &tls.Config{ServerName: t.Address}
+	}
+
+	return tls.Dial(PROTOCOL, net.JoinHostPort(t.Address, t.Port), cfg)
+}
+
+// SendsBanner always returns true, ServerQuery over TLS still sends the welcome banner
+func (t *TLSTransport) SendsBanner() bool {
+	return true
+}
+
+// SSHTransport dials the ServerQuery endpoint over SSH using password
+// authentication, as exposed on port 10022 by modern TeamSpeak servers
+type SSHTransport struct {
+	Address  string
+	Port     string
+	Username string
+	Password string
+	//HostKeyCallback verifies the server's host key, if left nil
+	//ssh.InsecureIgnoreHostKey is used
+	HostKeyCallback ssh.HostKeyCallback
+}
+
+// Dial opens an SSH connection to Address:Port, authenticates with Username/Password,
+// and starts an interactive shell session, ServerQuery commands are sent and read
+// through that session
+func (s *SSHTransport) Dial() (io.ReadWriteCloser, error) {
+	cb := s.HostKeyCallback
+	if cb == nil {
+		cb = ssh.InsecureIgnoreHostKey()
+	}
+
+	client, err := ssh.Dial(PROTOCOL, net.JoinHostPort(s.Address, s.Port), &ssh.ClientConfig{
+		User:            s.Username,
+		Auth:            []ssh.AuthMethod{ssh.Password(s.Password)},
+		HostKeyCallback: cb,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	if err := session.Shell(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &sshConn{client: client, session: session, stdin: stdin, stdout: stdout}, nil
+}
+
+// SendsBanner always returns false, the ServerQuery SSH shell does not send the
+// two-line welcome banner that the plain and TLS transports do
+func (s *SSHTransport) SendsBanner() bool {
+	return false
+}
+
+// sshConn adapts an SSH session's stdin/stdout pipes, plus the client that owns
+// them, to the io.ReadWriteCloser shape Transport.Dial returns
+type sshConn struct {
+	client  *ssh.Client
+	session *ssh.Session
+	stdin   io.WriteCloser
+	stdout  io.Reader
+}
+
+func (c *sshConn) Read(p []byte) (int, error) {
+	return c.stdout.Read(p)
+}
+
+func (c *sshConn) Write(p []byte) (int, error) {
+	return c.stdin.Write(p)
+}
+
+func (c *sshConn) Close() error {
+	c.session.Close()
+	return c.client.Close()
+}
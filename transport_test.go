@@ -0,0 +1,54 @@
+package tsgo
+
+import "testing"
+
+func TestTransportSendsBanner(t *testing.T) {
+	cases := []struct {
+		name string
+		tr   Transport
+		want bool
+	}{
+		{"plain", &PlainTransport{}, true},
+		{"tls", &TLSTransport{}, true},
+		{"ssh", &SSHTransport{}, false},
+	}
+
+	for _, c := range cases {
+		if got := c.tr.SendsBanner(); got != c.want {
+			t.Errorf("%s.SendsBanner() = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestNewDefaultsToPlainTransport(t *testing.T) {
+	bot, err := New(Config{Address: "localhost", Port: "10011", Username: "u", Password: "p"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tb, ok := bot.(*tsBot)
+	if !ok {
+		t.Fatalf("New did not return a *tsBot, got %T", bot)
+	}
+
+	pt, ok := tb.transport.(*PlainTransport)
+	if !ok {
+		t.Fatalf("expected the default transport to be *PlainTransport, got %T", tb.transport)
+	}
+	if pt.Address != "localhost" || pt.Port != "10011" {
+		t.Fatalf("unexpected PlainTransport fields: %+v", pt)
+	}
+}
+
+func TestNewUsesConfiguredTransport(t *testing.T) {
+	ssh := &SSHTransport{Address: "localhost", Port: "10022"}
+	bot, err := New(Config{Address: "localhost", Port: "10022", Username: "u", Password: "p", Transport: ssh})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tb := bot.(*tsBot)
+	if tb.transport != Transport(ssh) {
+		t.Fatalf("expected the configured Transport to be used as-is, got %+v", tb.transport)
+	}
+}
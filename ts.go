@@ -6,13 +6,14 @@ package tsgo
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
-	"net"
+	"io"
 	"os"
 	"os/signal"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -34,6 +35,9 @@ const (
 	//prevents the read() call from hanging indefinitely and allows more graceful
 	//exits/disconnects
 	MSG_READ_DEADLINE = time.Minute * 1
+	//the number of errors that can be queued on the errors channel before
+	//newly reported errors are dropped
+	ERROR_CHAN_BUFFER = 16
 )
 
 var (
@@ -72,6 +76,23 @@ type Config struct {
 	//bot which server to use. The port option is currently not supported by
 	//tsgo and the server ID must be used
 	Server int
+	//Logger receives structured log lines from the bot, if left nil all
+	//logging is discarded
+	Logger Logger
+	//Reconnect configures automatic reconnection after the connection to the
+	//server is lost, if left nil a lost connection is fatal
+	Reconnect *ReconnectPolicy
+	//KeepaliveInterval, if set, causes the bot to issue a cheap ServerQuery
+	//command on this interval to prevent the server from dropping an idle
+	//connection. This should be set shorter than the server's idle timeout
+	KeepaliveInterval time.Duration
+	//HandleSignals, if true, makes Start/StartContext stop the bot on os.Interrupt.
+	//Left false by default so embedding this library in a larger process doesn't
+	//install a process-wide signal handler behind the caller's back
+	HandleSignals bool
+	//Transport controls how the bot connects to the server, if left nil a
+	//PlainTransport is used, preserving the original plain TCP behavior
+	Transport Transport
 }
 
 // Message contains the needed fields for notifytextmessage events
@@ -92,15 +113,50 @@ type Message struct {
 type Handler func(m Message) (string, error)
 
 type tsBot struct {
-	server net.Conn
-	reader *bufio.Scanner
-	//used to trigger bot shutdown
-	kill chan os.Signal
-	//essentially used as a waitgroup to ensure the listener routine
-	//finishes before the bot fully shuts down
-	clean   chan struct{}
+	// connMu guards server and reader, which are reassigned by connect/reconnectOnce
+	// on every (re)connect while read()/write()/listenLoop may be accessing them
+	// from other goroutines
+	connMu    sync.RWMutex
+	server    io.ReadWriteCloser
+	transport Transport
+	reader    *bufio.Scanner
+	//ctx governs the bot's lifecycle, cancelling it (directly, via Shutdown, or
+	//via an os.Interrupt when Config.HandleSignals is set) stops the listener
+	//and keepalive routines
+	ctx    context.Context
+	cancel context.CancelFunc
+	//wg tracks the listener and keepalive routines so close can wait for them
+	//to drain before returning
+	wg      sync.WaitGroup
 	cfg     Config
 	handler Handler
+
+	// cmdMu guards cmdQueue and serializes writes so that a command's position
+	// in the queue always matches the order it was written to the server in
+	cmdMu    sync.Mutex
+	cmdQueue []*pendingCommand
+
+	// registered typed event handlers, see events.go
+	onClientEnter    ClientEnterHandler
+	onClientLeft     ClientLeftHandler
+	onClientMoved    ClientMovedHandler
+	onChannelCreated ChannelCreatedHandler
+	onPrivateMessage PrivateMessageHandler
+	onServerMessage  ServerMessageHandler
+
+	logger Logger
+	errCh  chan error
+
+	reconnect     *ReconnectPolicy
+	subsMu        sync.Mutex
+	subscriptions []subscription
+
+	// handshakeMu is held for the duration of the reconnect handshake (connect,
+	// login, use, replaySubscriptions), which reads replies directly off t.read()
+	// instead of through cmdQueue. keepaliveLoop takes it for the duration of its
+	// own SendCommand call so a keepalive can't land on the wire while the
+	// handshake is still waiting on one of its own replies
+	handshakeMu sync.RWMutex
 }
 
 type TsBot interface {
@@ -109,9 +165,44 @@ type TsBot interface {
 	listen() error
 	Start() error
 	login() error
-	close() error
+	close(waitCtx context.Context) error
 	parseResponse(res string) (*response, error)
-	AddHandler(f Handler)
+
+	// AddHandler configures the message handler that notifytextmessage events are
+	// forwarded to. f must be a Handler or a *Router
+	AddHandler(f interface{}) error
+
+	// StartContext behaves like Start, but ties the bot's lifecycle to ctx: cancelling
+	// ctx, or calling Shutdown, stops the bot and causes StartContext to return
+	StartContext(ctx context.Context) error
+	// Shutdown stops the bot and waits for its background routines to drain,
+	// honoring ctx's deadline while waiting
+	Shutdown(ctx context.Context) error
+
+	// SendCommand runs a ServerQuery command and returns its parsed response,
+	// it may be called from any goroutine while notifications continue to flow
+	SendCommand(cmd string, args map[string]string, options []string) (*Response, error)
+	ClientList() ([]map[string]string, error)
+	ChannelList() ([]map[string]string, error)
+	ClientMove(clientID, channelID int) error
+	ClientKick(clientID int, reasonMsg string) error
+	ClientPoke(clientID int, msg string) error
+	ChannelCreate(name string) (int, error)
+	ServerNotifyRegister(event, id string) error
+
+	// Subscribe registers the bot to receive the given EventType, delivering
+	// notifications to whichever On* handler has been registered for it
+	Subscribe(event EventType, id int) error
+	OnClientEnter(h ClientEnterHandler)
+	OnClientLeft(h ClientLeftHandler)
+	OnClientMoved(h ClientMovedHandler)
+	OnChannelCreated(h ChannelCreatedHandler)
+	OnPrivateMessage(h PrivateMessageHandler)
+	OnServerMessage(h ServerMessageHandler)
+
+	// ErrorsChan returns a channel that receives every error the listener
+	// routine encounters, in addition to whatever Logger is configured
+	ErrorsChan() <-chan error
 }
 
 // New creates a new bot instance, verifying that the required configuration fields are present before
@@ -120,23 +211,52 @@ func New(cfg Config) (TsBot, error) {
 	if cfg.Address == "" || cfg.Password == "" || cfg.Username == "" || cfg.Port == "" {
 		return nil, errors.New("invalid configuration, ensure all fields are present")
 	}
-	k := make(chan os.Signal, 1)
-	signal.Notify(k, os.Interrupt)
+
+	logger := cfg.Logger
+	if logger == nil {
+		logger = noopLogger{}
+	}
+
+	transport := cfg.Transport
+	if transport == nil {
+		transport = &PlainTransport{Address: cfg.Address, Port: cfg.Port}
+	}
+
 	return &tsBot{
-		kill:  k,
-		cfg:   cfg,
-		clean: make(chan struct{}),
+		cfg:       cfg,
+		logger:    logger,
+		transport: transport,
+		errCh:     make(chan error, ERROR_CHAN_BUFFER),
+		reconnect: cfg.Reconnect,
 	}, nil
 }
 
+// conn returns the current server connection, guarded by connMu so callers never
+// observe a connection or scanner mid-swap by a concurrent (re)connect
+func (t *tsBot) conn() (io.ReadWriteCloser, *bufio.Scanner) {
+	t.connMu.RLock()
+	defer t.connMu.RUnlock()
+	return t.server, t.reader
+}
+
+// setConn installs a newly dialed connection and its scanner, guarded by connMu
+// so read()/write() never observe a partially updated pair
+func (t *tsBot) setConn(conn io.ReadWriteCloser, reader *bufio.Scanner) {
+	t.connMu.Lock()
+	defer t.connMu.Unlock()
+	t.server = conn
+	t.reader = reader
+}
+
 // read attempts to read data from the server connection, if data is present, it is returned
 func (t *tsBot) read() (string, error) {
-	if t.server == nil || t.reader == nil {
+	server, reader := t.conn()
+	if server == nil || reader == nil {
 		return "", ErrNotConnected
 	}
 
-	if t.reader.Scan() {
-		return t.reader.Text(), nil
+	if reader.Scan() {
+		return reader.Text(), nil
 	}
 
 	return "", nil
@@ -145,7 +265,8 @@ func (t *tsBot) read() (string, error) {
 // write handles writing messages back to the remote server. All TeamSpeak messages must end
 // in a newline character, it is automatically added if it is missing
 func (t *tsBot) write(msg string) error {
-	if t.server == nil || t.reader == nil {
+	server, reader := t.conn()
+	if server == nil || reader == nil {
 		return ErrNotConnected
 	}
 
@@ -155,122 +276,150 @@ func (t *tsBot) write(msg string) error {
 	}
 
 	//messages must end in newlines, this should probably eventually check for it before adding it
-	_, err := t.server.Write([]byte(msg))
+	_, err := server.Write([]byte(msg))
 	return err
 }
 
-// listen configures the server to receive message events. To do this two messages are sent to the server: first is to configure
-// which TeamSpeak server the bot should attach itself to, the second configures the bot to listen for notifytextmessage events.
-// If configuration is successful, a listener routine is spawned to continuously parse and handle messages until the bot is shutdown
+// listen configures the server to receive message events. To do this the bot selects which
+// TeamSpeak server to attach itself to, then registers the default textchannel subscription (or,
+// if subscriptions already exist from a previous connection, replays all of them). If configuration
+// is successful, a listener routine and a keepalive routine are spawned, running until the bot is shutdown
 func (t *tsBot) listen() error {
 	err := t.writeSuccess(fmt.Sprintf(SERVER_USE_STRING, t.cfg.Server))
 	if err != nil {
 		return err
 	}
 
-	err = t.writeSuccess(MSG_LISTENER_STRING)
-	if err != nil {
-		return err
+	t.subsMu.Lock()
+	hasSubscriptions := len(t.subscriptions) > 0
+	t.subsMu.Unlock()
+
+	if hasSubscriptions {
+		if err := t.replaySubscriptions(); err != nil {
+			return err
+		}
+	} else {
+		if err := t.writeSuccess(MSG_LISTENER_STRING); err != nil {
+			return err
+		}
+		t.subsMu.Lock()
+		t.subscriptions = append(t.subscriptions, subscription{event: EventTextChannel})
+		t.subsMu.Unlock()
 	}
 
-	//a listener routine that loops until the kill channel is hit, parsing all messages and responding as
-	//needed. A read deadline is set after each read to prevent locking, the clean channel will be hit once
-	//the routine has finished completely
-	go func() {
-		for len(t.kill) == 0 {
-			t.server.SetReadDeadline(time.Now().Add(MSG_READ_DEADLINE))
-			res, err := t.read()
-			if os.IsTimeout(err) {
-				continue
+	t.wg.Add(2)
+	go t.listenLoop()
+	go t.keepaliveLoop()
+
+	return nil
+}
+
+// listenLoop continuously reads and dispatches messages from the server until ctx is done.
+// A read deadline is set after each read to prevent locking. If the connection is lost and
+// Config.Reconnect is set, the loop re-establishes the connection instead of exiting
+func (t *tsBot) listenLoop() {
+	defer t.wg.Done()
+
+	//records accumulated for the ServerQuery command currently awaiting its
+	//terminating "error id=... msg=..." line
+	var pendingRecords []map[string]string
+
+	for t.ctx.Err() == nil {
+		//not every Transport's connection supports read deadlines (the SSH
+		//transport doesn't), so this is best-effort
+		if conn, _ := t.conn(); conn != nil {
+			if dl, ok := conn.(deadlineSetter); ok {
+				dl.SetReadDeadline(time.Now().Add(MSG_READ_DEADLINE))
 			}
-			if err != nil {
-				fmt.Println(err)
+		}
+		res, err := t.read()
+		if os.IsTimeout(err) {
+			continue
+		}
+		if err != nil {
+			t.reportError("listener read failed", err)
+			if !t.reconnectLoop() {
 				break
 			}
+			pendingRecords = nil
+			continue
+		}
 
-			if res == "" || res == "\n" {
-				continue
-			}
-
-			r, err := t.parseResponse(res)
-			if err != nil {
-				fmt.Println(err)
-				continue
-			}
+		trimmed := strings.TrimSpace(res)
+		if trimmed == "" {
+			continue
+		}
 
-			//prevent the bot from responding to itself
-			if r.Data["invokeruid"] == t.cfg.Username {
-				continue
+		//a line that isn't a notification is either the terminating error line of a
+		//command response, or a data record that precedes one, route it to whichever
+		//SendCommand call is oldest in the queue instead of the notification handler
+		if !strings.HasPrefix(trimmed, "notify") {
+			if strings.HasPrefix(trimmed, "error ") {
+				t.completeCommand(pendingRecords, trimmed)
+				pendingRecords = nil
+			} else {
+				pendingRecords = append(pendingRecords, parseRecords(trimmed)...)
 			}
+			continue
+		}
 
-			if r.Action == MSG_ACTION {
-				invId, err := strconv.Atoi(r.Data["invokerid"])
-				if err != nil {
-					fmt.Println(err)
-					continue
-				}
-
-				reply, err := t.handler(Message{
-					Msg:         r.Msg(),
-					InvokerID:   invId,
-					InvokerName: r.Data["invokername"],
-					InvokerUID:  r.Data["invokeruid"],
-				})
-				if err != nil {
-					fmt.Println(err)
-					continue
-				}
-
-				if reply != "" {
-					err := t.write(fmt.Sprintf("sendtextmessage targetmode=2 target=%d msg=%s", invId, strings.ReplaceAll(reply, " ", "\\s")))
-					if err != nil {
-						fmt.Println(err)
-						continue
-					}
-				}
-			}
+		r, err := t.parseResponse(res)
+		if err != nil {
+			t.reportError("failed to parse server response", err, "raw", res)
+			continue
 		}
-		t.clean <- struct{}{}
-	}()
 
-	return nil
+		//dispatchEvent runs on its own goroutine so a handler calling SendCommand
+		//doesn't deadlock waiting on a reply that only this routine can deliver
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			t.dispatchEvent(r)
+		}()
+	}
 }
 
 // Start creates the tcp connection to the teamspeak server and initializes the scanner to read from the server. On successful
 // connection it will read two lines to consume the welcome banner to prevent errors parsing irregular messages. A login attempt
-// is the made and, if successful, listen for messages. This is a blocking call that will listen for messages until the kill channel
-// is hit, it will then handle safe shutdown disconnecting from the server
+// is the made and, if successful, listen for messages. This is a blocking call that will listen for messages until the bot's
+// context is done, it will then handle safe shutdown disconnecting from the server. Start is equivalent to calling
+// StartContext with context.Background()
 func (t *tsBot) Start() error {
-	conn, err := net.Dial(PROTOCOL, net.JoinHostPort(t.cfg.Address, t.cfg.Port))
-	if err != nil {
-		return err
-	}
-
-	t.server = conn
-	t.reader = bufio.NewScanner(conn)
+	return t.StartContext(context.Background())
+}
 
-	//read teamspeak 'welcome' banner
-	for x := 0; x < BANNER_LENGTH; x++ {
-		if _, err := t.read(); err != nil {
-			return err
-		}
+// StartContext behaves like Start, except the bot's lifecycle is tied to ctx instead of
+// always running until process exit: cancelling ctx, or calling Shutdown, stops the listener
+// and keepalive routines and causes StartContext to return. If Config.HandleSignals is set,
+// an os.Interrupt also cancels the bot's lifecycle
+func (t *tsBot) StartContext(ctx context.Context) error {
+	t.ctx, t.cancel = context.WithCancel(ctx)
+
+	if t.cfg.HandleSignals {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt)
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			defer signal.Stop(sig)
+			select {
+			case <-sig:
+				t.cancel()
+			case <-t.ctx.Done():
+			}
+		}()
 	}
 
-	err = t.login()
-	if err != nil {
+	if err := t.connect(); err != nil {
 		return err
 	}
 
-	err = t.listen()
-	if err != nil {
+	if err := t.listen(); err != nil {
 		return err
 	}
 
-	<-t.kill
-	//resend out the interrupt signal as an added measure since the above line will consume the
-	//initial one. This is an added failsafe to encourage the go routine to clean itself up
-	t.kill <- os.Interrupt
-	return t.close()
+	<-t.ctx.Done()
+	return t.close(context.Background())
 }
 
 // login send the authentication message to the server, erroring if login was not successful
@@ -279,12 +428,35 @@ func (t *tsBot) login() error {
 }
 
 // close handles proper bot shutdown, the underlying tcp connection is closed to timeout any read calls
-// waiting in the listener routine. This allows the routine to be cleaned up without waiting for the read
-// deadline to be triggered, close will wait for the routine to signal its cleaned up before returning
-func (t *tsBot) close() error {
-	err := t.server.Close()
-	<-t.clean
-	return err
+// waiting in the listener routine. This allows the routines to be cleaned up without waiting for the
+// read deadline to be triggered, close then waits for every routine tracked in wg to drain, honoring
+// waitCtx's deadline instead of waiting forever
+func (t *tsBot) close(waitCtx context.Context) error {
+	conn, _ := t.conn()
+	err := conn.Close()
+
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-waitCtx.Done():
+		return waitCtx.Err()
+	}
+}
+
+// Shutdown stops the bot by cancelling its lifecycle context, then waits for the listener and
+// keepalive routines to drain, honoring ctx's deadline while waiting. Shutdown is safe to call
+// even if the bot's context was already cancelled some other way
+func (t *tsBot) Shutdown(ctx context.Context) error {
+	if t.cancel != nil {
+		t.cancel()
+	}
+	return t.close(ctx)
 }
 
 // writeSuccess writes data to this server and checks for a successful response. The server reply
@@ -346,8 +518,20 @@ func (t *tsBot) parseResponse(res string) (*response, error) {
 	return r, nil
 }
 
-// AddHandler configures the message handler function to forward server
-// messages to
-func (t *tsBot) AddHandler(f Handler) {
-	t.handler = f
+// AddHandler configures the message handler that notifytextmessage events are
+// forwarded to. f must be a Handler, or a *Router for bots with more than one
+// command; passing a *Router is equivalent to AddHandler(router.Dispatch)
+func (t *tsBot) AddHandler(f interface{}) error {
+	switch h := f.(type) {
+	case Handler:
+		t.handler = h
+	case func(Message) (string, error):
+		t.handler = Handler(h)
+	case *Router:
+		t.handler = h.Dispatch
+	default:
+		return fmt.Errorf("tsgo: AddHandler: unsupported handler type %T", f)
+	}
+
+	return nil
 }